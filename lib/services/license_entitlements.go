@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+)
+
+// Well-known feature names understood by GetFeature. Licenses may also
+// carry feature names not listed here; unrecognized names are treated as
+// disabled by GetFeature's callers.
+const (
+	// FeatureKubernetes gates Kubernetes cluster access.
+	FeatureKubernetes = "kubernetes"
+	// FeatureAppAccess gates application access.
+	FeatureAppAccess = "app_access"
+	// FeatureDBAccess gates database access.
+	FeatureDBAccess = "db_access"
+	// FeatureMaxNodes caps the number of nodes a cluster may register.
+	FeatureMaxNodes = "max_nodes"
+	// FeatureMaxUsers caps the number of users a cluster may register.
+	FeatureMaxUsers = "max_users"
+)
+
+// FeatureEntitlement describes whether a named feature is enabled for a
+// license and, optionally, how much of it may be used.
+type FeatureEntitlement struct {
+	// Enabled turns the feature on or off.
+	Enabled Bool `json:"enabled"`
+	// Limit caps how many units of the feature may be used, e.g. number of
+	// nodes for FeatureMaxNodes. Zero means unlimited.
+	Limit int64 `json:"limit,omitempty"`
+	// ExpiresAt is the time at which this entitlement stops being honored,
+	// independent of the license's own expiry. Nil means the entitlement
+	// never expires on its own. A *time.Time (rather than time.Time) is
+	// used so that omitempty actually suppresses the field when unset.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IsExpired returns true if the entitlement has an ExpiresAt in the past
+// relative to now.
+func (f FeatureEntitlement) IsExpired(now time.Time) bool {
+	return f.ExpiresAt != nil && now.After(*f.ExpiresAt)
+}
+
+// LicenseEnforcer checks registered node and user counts against the
+// limits granted by a license's entitlements, refusing to admit new ones
+// past the licensed limit.
+type LicenseEnforcer struct {
+	// License is consulted for the current set of feature entitlements.
+	License LicenseInfo
+	// CountNodes returns the number of nodes currently registered with the
+	// cluster.
+	CountNodes func() (int64, error)
+	// CountUsers returns the number of users currently registered with the
+	// cluster.
+	CountUsers func() (int64, error)
+	// EmitAuditEvent is invoked whenever admission is refused because a
+	// license limit has been reached. May be nil.
+	EmitAuditEvent func(event string, fields map[string]interface{})
+	// Clock is used to evaluate entitlement expiry and is configurable for
+	// tests. Defaults to the real clock.
+	Clock clockwork.Clock
+}
+
+// LicenseLimitReachedEvent is the audit event emitted when a cluster
+// refuses to admit a new node or user because a license entitlement limit
+// has been reached.
+const LicenseLimitReachedEvent = "license.limit_reached"
+
+// NewLicenseEnforcer returns a LicenseEnforcer that checks license against
+// the results of countNodes and countUsers, emitting auditEvent when a
+// limit is breached.
+func NewLicenseEnforcer(license LicenseInfo, countNodes, countUsers func() (int64, error), emitAuditEvent func(string, map[string]interface{})) *LicenseEnforcer {
+	return &LicenseEnforcer{
+		License:        license,
+		CountNodes:     countNodes,
+		CountUsers:     countUsers,
+		EmitAuditEvent: emitAuditEvent,
+		Clock:          clockwork.NewRealClock(),
+	}
+}
+
+// CheckAdmitNode returns an error if admitting one more node would exceed
+// the license's FeatureMaxNodes entitlement.
+func (e *LicenseEnforcer) CheckAdmitNode() error {
+	return e.checkAdmit(FeatureMaxNodes, e.CountNodes)
+}
+
+// CheckAdmitUser returns an error if admitting one more user would exceed
+// the license's FeatureMaxUsers entitlement.
+func (e *LicenseEnforcer) CheckAdmitUser() error {
+	return e.checkAdmit(FeatureMaxUsers, e.CountUsers)
+}
+
+func (e *LicenseEnforcer) checkAdmit(feature string, count func() (int64, error)) error {
+	entitlement := e.License.GetFeature(feature)
+	if entitlement.Limit <= 0 {
+		return nil
+	}
+	clock := e.Clock
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+	if entitlement.IsExpired(clock.Now()) {
+		return trace.AccessDenied("license entitlement for %q expired at %v", feature, entitlement.ExpiresAt)
+	}
+
+	if count == nil {
+		return trace.BadParameter("no counter configured for feature %q", feature)
+	}
+	current, err := count()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if current < entitlement.Limit {
+		return nil
+	}
+
+	if e.EmitAuditEvent != nil {
+		e.EmitAuditEvent(LicenseLimitReachedEvent, map[string]interface{}{
+			"feature": feature,
+			"limit":   entitlement.Limit,
+			"current": current,
+		})
+	}
+	return trace.AccessDenied("license limit of %v for %q reached", entitlement.Limit, feature)
+}
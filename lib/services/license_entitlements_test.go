@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"gopkg.in/check.v1"
+)
+
+type LicenseEntitlementsSuite struct{}
+
+var _ = check.Suite(&LicenseEntitlementsSuite{})
+
+func (s *LicenseEntitlementsSuite) TestGetFeatureBackwardCompat(c *check.C) {
+	license := MustNew("license_info", LicenseInfoSpecV3{
+		SupportsKubernetes: NewBool(true),
+	})
+	c.Assert(license.GetFeature(FeatureKubernetes).Enabled.Value(), check.Equals, true)
+	c.Assert(license.GetSupportsKubernetes().Value(), check.Equals, true)
+
+	license.SetSupportsKubernetes(NewBool(false))
+	c.Assert(license.GetFeature(FeatureKubernetes).Enabled.Value(), check.Equals, false)
+	c.Assert(license.GetSupportsKubernetes().Value(), check.Equals, false)
+
+	c.Assert(license.GetFeature(FeatureMaxNodes), check.Equals, FeatureEntitlement{})
+}
+
+func (s *LicenseEntitlementsSuite) TestLicenseEnforcer(c *check.C) {
+	license := MustNew("license_info", LicenseInfoSpecV3{
+		Features: map[string]FeatureEntitlement{
+			FeatureMaxNodes: {Enabled: NewBool(true), Limit: 2},
+		},
+	})
+
+	var events []string
+	countNodes := func() (int64, error) { return 2, nil }
+	enforcer := NewLicenseEnforcer(license, countNodes, nil, func(event string, fields map[string]interface{}) {
+		events = append(events, event)
+	})
+
+	err := enforcer.CheckAdmitNode()
+	c.Assert(trace.IsAccessDenied(err), check.Equals, true)
+	c.Assert(events, check.DeepEquals, []string{LicenseLimitReachedEvent})
+
+	enforcer.CountNodes = func() (int64, error) { return 1, nil }
+	c.Assert(enforcer.CheckAdmitNode(), check.IsNil)
+}
+
+func (s *LicenseEntitlementsSuite) TestLicenseEnforcerNilCounter(c *check.C) {
+	license := MustNew("license_info", LicenseInfoSpecV3{
+		Features: map[string]FeatureEntitlement{
+			FeatureMaxUsers: {Enabled: NewBool(true), Limit: 2},
+		},
+	})
+	enforcer := NewLicenseEnforcer(license, nil, nil, nil)
+
+	err := enforcer.CheckAdmitUser()
+	c.Assert(trace.IsBadParameter(err), check.Equals, true)
+}
+
+func (s *LicenseEntitlementsSuite) TestLicenseEnforcerExpiredEntitlementDenies(c *check.C) {
+	expiresAt := time.Now().Add(-time.Hour)
+	license := MustNew("license_info", LicenseInfoSpecV3{
+		Features: map[string]FeatureEntitlement{
+			FeatureMaxNodes: {Enabled: NewBool(true), Limit: 2, ExpiresAt: &expiresAt},
+		},
+	})
+
+	countCalled := false
+	enforcer := NewLicenseEnforcer(license, func() (int64, error) {
+		countCalled = true
+		return 0, nil
+	}, nil, nil)
+	enforcer.Clock = clockwork.NewRealClock()
+
+	err := enforcer.CheckAdmitNode()
+	c.Assert(trace.IsAccessDenied(err), check.Equals, true)
+	c.Assert(countCalled, check.Equals, false)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type LicenseSigningSuite struct{}
+
+var _ = check.Suite(&LicenseSigningSuite{})
+
+func (s *LicenseSigningSuite) TestVerifyLicense(c *check.C) {
+	pub1, priv1, err := ed25519.GenerateKey(nil)
+	c.Assert(err, check.IsNil)
+	pub2, priv2, err := ed25519.GenerateKey(nil)
+	c.Assert(err, check.IsNil)
+
+	trustedKeys := map[string]ed25519.PublicKey{
+		"key-1": pub1,
+		"key-2": pub2,
+	}
+
+	newLicense := func() *LicenseInfoV3 {
+		license, err := NewLicenseInfo("Teleport Commercial", LicenseInfoSpecV3{
+			AccountID: "accountID",
+		})
+		c.Assert(err, check.IsNil)
+		return license.(*LicenseInfoV3)
+	}
+
+	c.Log("unsigned license is refused")
+	unsigned := newLicense()
+	c.Assert(VerifyLicense(unsigned, trustedKeys), check.NotNil)
+
+	c.Log("license signed with a trusted key rotates cleanly across key_id")
+	for keyID, priv := range map[string]ed25519.PrivateKey{"key-1": priv1, "key-2": priv2} {
+		signed := newLicense()
+		c.Assert(SignLicense(signed, keyID, priv), check.IsNil)
+		c.Assert(VerifyLicense(signed, trustedKeys), check.IsNil)
+	}
+
+	c.Log("tampered payload fails verification")
+	tampered := newLicense()
+	c.Assert(SignLicense(tampered, "key-1", priv1), check.IsNil)
+	tampered.Spec.AccountID = "someone-else"
+	c.Assert(VerifyLicense(tampered, trustedKeys), check.NotNil)
+
+	c.Log("signature from an unknown key is rejected")
+	unknownKey := newLicense()
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(SignLicense(unknownKey, "key-99", otherPriv), check.IsNil)
+	c.Assert(VerifyLicense(unknownKey, trustedKeys), check.NotNil)
+
+	c.Log("clock skew: license not yet valid is rejected")
+	notYetValid := newLicense()
+	notYetValidAt := time.Now().Add(time.Hour)
+	notYetValid.Spec.NotBefore = &notYetValidAt
+	c.Assert(SignLicense(notYetValid, "key-1", priv1), check.IsNil)
+	c.Assert(VerifyLicense(notYetValid, trustedKeys), check.NotNil)
+
+	c.Log("clock skew: expired license is rejected")
+	expired := newLicense()
+	expired.SetExpiry(time.Now().Add(-time.Hour))
+	c.Assert(SignLicense(expired, "key-1", priv1), check.IsNil)
+	c.Assert(VerifyLicense(expired, trustedKeys), check.NotNil)
+
+	c.Log("UnmarshalLicenseInfo with WithRequireSignature refuses unsigned licenses")
+	_, err = UnmarshalLicenseInfo(
+		[]byte(`{"kind": "license_info", "version": "v3", "metadata": {"name": "x"}, "spec": {}}`),
+		WithRequireSignature(trustedKeys),
+	)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *LicenseSigningSuite) TestMarshalOmitsUnsetTimeFields(c *check.C) {
+	license, err := NewLicenseInfo("license_info", LicenseInfoSpecV3{
+		AccountID: "accountID",
+		Features: map[string]FeatureEntitlement{
+			FeatureKubernetes: {Enabled: NewBool(true)},
+		},
+	})
+	c.Assert(err, check.IsNil)
+
+	data, err := MarshalLicenseInfo(license)
+	c.Assert(err, check.IsNil)
+
+	var raw map[string]interface{}
+	c.Assert(json.Unmarshal(data, &raw), check.IsNil)
+	spec, ok := raw["spec"].(map[string]interface{})
+	c.Assert(ok, check.Equals, true)
+
+	_, hasNotBefore := spec["not_before"]
+	c.Assert(hasNotBefore, check.Equals, false)
+	_, hasSignature := spec["signature"]
+	c.Assert(hasSignature, check.Equals, false)
+
+	features, ok := spec["features"].(map[string]interface{})
+	c.Assert(ok, check.Equals, true)
+	entitlement, ok := features[FeatureKubernetes].(map[string]interface{})
+	c.Assert(ok, check.Equals, true)
+	_, hasExpiresAt := entitlement["expires_at"]
+	c.Assert(hasExpiresAt, check.Equals, false)
+}
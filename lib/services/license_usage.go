@@ -0,0 +1,304 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultUsageReportInterval is used when a license sets ReportsUsage but
+// leaves UsageReportInterval unset.
+const defaultUsageReportInterval = time.Hour
+
+// UsageCounters are the anonymized, aggregate counters collected by
+// UsageReporter on every reporting interval.
+type UsageCounters struct {
+	// ActiveSessions is the number of currently active sessions.
+	ActiveSessions int64 `json:"active_sessions"`
+	// NodeCount is the number of nodes registered with the cluster.
+	NodeCount int64 `json:"node_count"`
+	// KubeExecCount is the number of kubectl exec sessions observed since
+	// the last report.
+	KubeExecCount int64 `json:"kube_exec_count"`
+	// DistinctUsers is the number of distinct users active since the last
+	// report.
+	DistinctUsers int64 `json:"distinct_users"`
+}
+
+// UsageReportBuffer persists usage reports locally when the control plane
+// is unreachable, so they can be retried once connectivity returns.
+type UsageReportBuffer interface {
+	// Append stores report for later delivery.
+	Append(report []byte) error
+	// Pending returns all buffered reports, oldest first.
+	Pending() ([][]byte, error)
+	// Clear removes reports that have been successfully delivered.
+	Clear(reports [][]byte) error
+}
+
+// UsageReporterConfig configures a UsageReporter.
+type UsageReporterConfig struct {
+	// License is consulted for whether usage reporting is enabled and
+	// where/how often to report.
+	License LicenseInfo
+	// Collect gathers the current usage counters.
+	Collect func() (UsageCounters, error)
+	// Sign signs a report payload with the cluster's host CA so the
+	// receiver can attribute the report to this cluster.
+	Sign func(payload []byte) (signature []byte, err error)
+	// Buffer persists reports that could not be delivered immediately.
+	Buffer UsageReportBuffer
+	// Client delivers reports to the license's UsageReportEndpoint.
+	// Defaults to http.DefaultClient.
+	Client *http.Client
+	// Clock schedules reporting and is configurable for tests. Defaults to
+	// the real clock.
+	Clock clockwork.Clock
+}
+
+// CheckAndSetDefaults validates the config and sets default values.
+func (cfg *UsageReporterConfig) CheckAndSetDefaults() error {
+	if cfg.License == nil {
+		return trace.BadParameter("License is required")
+	}
+	if cfg.Collect == nil {
+		return trace.BadParameter("Collect is required")
+	}
+	if cfg.Sign == nil {
+		return trace.BadParameter("Sign is required")
+	}
+	if cfg.Buffer == nil {
+		return trace.BadParameter("Buffer is required")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clockwork.NewRealClock()
+	}
+	return nil
+}
+
+var (
+	usageReportsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "teleport",
+		Subsystem: "license",
+		Name:      "usage_reports_sent_total",
+		Help:      "Number of usage reports successfully delivered to the control plane",
+	})
+	usageReportsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "teleport",
+		Subsystem: "license",
+		Name:      "usage_reports_failed_total",
+		Help:      "Number of usage reports that failed to deliver to the control plane",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(usageReportsSent, usageReportsFailed)
+}
+
+// UsageReporter periodically collects anonymized usage counters and ships
+// them to the license's configured usage reporting endpoint. Reports are
+// gzip-compressed, signed with the cluster's host CA, and buffered
+// locally when the endpoint can't be reached, so reporting never blocks
+// or fails authentication.
+type UsageReporter struct {
+	cfg UsageReporterConfig
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewUsageReporter validates cfg and returns a UsageReporter ready to run.
+func NewUsageReporter(cfg UsageReporterConfig) (*UsageReporter, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &UsageReporter{cfg: cfg}, nil
+}
+
+// Run collects and sends a usage report on the license's
+// UsageReportInterval until ctx is canceled. It does nothing if the
+// license does not have ReportsUsage set. Run must not be called again
+// until a prior call has returned (e.g. after Close).
+func (r *UsageReporter) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.mu.Unlock()
+		log.Warningf("UsageReporter.Run called while already running, ignoring.")
+		cancel()
+		return
+	}
+	r.cancel = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.cancel = nil
+		r.mu.Unlock()
+	}()
+
+	interval := defaultUsageReportInterval
+	if v3, ok := r.cfg.License.(*LicenseInfoV3); ok && v3.Spec.UsageReportInterval > 0 {
+		interval = v3.Spec.UsageReportInterval
+	}
+	ticker := r.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			r.reportOnce(ctx)
+		}
+	}
+}
+
+// Close stops a running UsageReporter.
+func (r *UsageReporter) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// reportOnce collects and delivers a single usage report, buffering it
+// for retry if delivery fails. It never returns an error: usage reporting
+// must degrade gracefully and never affect authentication.
+func (r *UsageReporter) reportOnce(ctx context.Context) {
+	if !r.cfg.License.GetReportsUsage().Value() {
+		return
+	}
+
+	counters, err := r.cfg.Collect()
+	if err != nil {
+		log.Warningf("Failed to collect usage counters: %v.", err)
+		return
+	}
+
+	report, err := r.buildReport(counters)
+	if err != nil {
+		log.Warningf("Failed to build usage report: %v.", err)
+		return
+	}
+
+	if err := r.flushPending(ctx); err != nil {
+		log.Debugf("Failed to flush buffered usage reports: %v.", err)
+	}
+
+	if err := r.send(ctx, report); err != nil {
+		log.Debugf("Failed to send usage report, buffering for retry: %v.", err)
+		if err := r.cfg.Buffer.Append(report); err != nil {
+			log.Warningf("Failed to buffer usage report: %v.", err)
+		}
+		usageReportsFailed.Inc()
+		return
+	}
+	usageReportsSent.Inc()
+}
+
+// buildReport gzip-compresses a JSON envelope containing counters and its
+// host-CA signature.
+func (r *UsageReporter) buildReport(counters UsageCounters) ([]byte, error) {
+	payload, err := json.Marshal(counters)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	signature, err := r.cfg.Sign(payload)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	envelope := struct {
+		Payload   json.RawMessage `json:"payload"`
+		Signature []byte          `json:"signature"`
+	}{Payload: payload, Signature: signature}
+	if err := json.NewEncoder(gz).Encode(envelope); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// flushPending attempts to deliver any previously buffered reports,
+// clearing from the buffer only the ones that were delivered
+// successfully.
+func (r *UsageReporter) flushPending(ctx context.Context) error {
+	pending, err := r.cfg.Buffer.Pending()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	delivered := make([][]byte, 0, len(pending))
+	for _, report := range pending {
+		if err := r.send(ctx, report); err != nil {
+			break
+		}
+		usageReportsSent.Inc()
+		delivered = append(delivered, report)
+	}
+	if len(delivered) == 0 {
+		return nil
+	}
+	return trace.Wrap(r.cfg.Buffer.Clear(delivered))
+}
+
+// send posts report to the license's UsageReportEndpoint.
+func (r *UsageReporter) send(ctx context.Context, report []byte) error {
+	v3, ok := r.cfg.License.(*LicenseInfoV3)
+	if !ok || v3.Spec.UsageReportEndpoint == "" {
+		return trace.BadParameter("no usage report endpoint configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v3.Spec.UsageReportEndpoint, bytes.NewReader(report))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return trace.BadParameter("usage report endpoint returned status %v", resp.StatusCode)
+	}
+	return nil
+}
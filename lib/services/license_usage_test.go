@@ -0,0 +1,143 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"gopkg.in/check.v1"
+)
+
+type LicenseUsageSuite struct{}
+
+var _ = check.Suite(&LicenseUsageSuite{})
+
+type memUsageReportBuffer struct {
+	mu      sync.Mutex
+	pending [][]byte
+}
+
+func (b *memUsageReportBuffer) Append(report []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, report)
+	return nil
+}
+
+func (b *memUsageReportBuffer) Pending() ([][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([][]byte(nil), b.pending...), nil
+}
+
+func (b *memUsageReportBuffer) Clear(reports [][]byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cleared := make(map[string]bool, len(reports))
+	for _, r := range reports {
+		cleared[string(r)] = true
+	}
+	var remaining [][]byte
+	for _, r := range b.pending {
+		if !cleared[string(r)] {
+			remaining = append(remaining, r)
+		}
+	}
+	b.pending = remaining
+	return nil
+}
+
+func (s *LicenseUsageSuite) newReporter(c *check.C, endpoint string) (*UsageReporter, *memUsageReportBuffer) {
+	license := MustNew("license_info", LicenseInfoSpecV3{
+		ReportsUsage:        NewBool(true),
+		UsageReportEndpoint: endpoint,
+	})
+	buffer := &memUsageReportBuffer{}
+	reporter, err := NewUsageReporter(UsageReporterConfig{
+		License: license,
+		Collect: func() (UsageCounters, error) {
+			return UsageCounters{NodeCount: 3}, nil
+		},
+		Sign: func(payload []byte) ([]byte, error) {
+			return []byte("signature"), nil
+		},
+		Buffer: buffer,
+	})
+	c.Assert(err, check.IsNil)
+	return reporter, buffer
+}
+
+func (s *LicenseUsageSuite) TestReportOnceDelivers(c *check.C) {
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	reporter, buffer := s.newReporter(c, server.URL)
+	reporter.reportOnce(context.Background())
+
+	select {
+	case <-received:
+	default:
+		c.Fatal("usage report was not delivered")
+	}
+	pending, err := buffer.Pending()
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 0)
+}
+
+func (s *LicenseUsageSuite) TestReportOnceBuffersOnFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	server.Close() // endpoint is unreachable
+
+	reporter, buffer := s.newReporter(c, server.URL)
+	reporter.reportOnce(context.Background())
+
+	pending, err := buffer.Pending()
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 1)
+}
+
+func (s *LicenseUsageSuite) TestReportOnceSkipsWhenUsageNotReported(c *check.C) {
+	license := MustNew("license_info", LicenseInfoSpecV3{
+		ReportsUsage: NewBool(false),
+	})
+	buffer := &memUsageReportBuffer{}
+	collectCalled := false
+	reporter, err := NewUsageReporter(UsageReporterConfig{
+		License: license,
+		Collect: func() (UsageCounters, error) {
+			collectCalled = true
+			return UsageCounters{}, nil
+		},
+		Sign: func(payload []byte) ([]byte, error) {
+			return []byte("signature"), nil
+		},
+		Buffer: buffer,
+	})
+	c.Assert(err, check.IsNil)
+
+	reporter.reportOnce(context.Background())
+	c.Assert(collectCalled, check.Equals, false)
+}
@@ -59,6 +59,16 @@ type LicenseInfo interface {
 	// SetSupportsKubernetes sets kubernetes support flag
 	SetSupportsKubernetes(Bool)
 
+	// IsSigned returns true if the license carries a cryptographic
+	// signature that can be checked with VerifyLicense.
+	IsSigned() bool
+
+	// GetFeature returns the entitlement for the named feature, e.g.
+	// FeatureKubernetes or FeatureMaxNodes. Licenses that predate the
+	// entitlements model synthesize an equivalent entitlement from their
+	// legacy fields.
+	GetFeature(name string) FeatureEntitlement
+
 	// SetLabels sets metadata labels
 	SetLabels(labels map[string]string)
 
@@ -191,12 +201,38 @@ func (c *LicenseInfoV3) SetAWSAccountID(accountID string) {
 
 // GetSupportsKubernetes returns kubernetes support flag
 func (c *LicenseInfoV3) GetSupportsKubernetes() Bool {
-	return c.Spec.SupportsKubernetes
+	return c.GetFeature(FeatureKubernetes).Enabled
 }
 
 // SetSupportsKubernetes sets kubernetes support flag
 func (c *LicenseInfoV3) SetSupportsKubernetes(supportsK8s Bool) {
 	c.Spec.SupportsKubernetes = supportsK8s
+	if c.Spec.Features == nil {
+		c.Spec.Features = make(map[string]FeatureEntitlement)
+	}
+	entitlement := c.Spec.Features[FeatureKubernetes]
+	entitlement.Enabled = supportsK8s
+	c.Spec.Features[FeatureKubernetes] = entitlement
+}
+
+// GetFeature returns the entitlement for the named feature. Legacy v3
+// licenses that predate the entitlements model only ever described
+// kubernetes support, so GetFeature(FeatureKubernetes) falls back to
+// SupportsKubernetes when no explicit entitlement is present.
+func (c *LicenseInfoV3) GetFeature(name string) FeatureEntitlement {
+	if entitlement, ok := c.Spec.Features[name]; ok {
+		return entitlement
+	}
+	if name == FeatureKubernetes {
+		return FeatureEntitlement{Enabled: c.Spec.SupportsKubernetes}
+	}
+	return FeatureEntitlement{}
+}
+
+// IsSigned returns true if the license carries a cryptographic signature
+// that can be checked with VerifyLicense.
+func (c *LicenseInfoV3) IsSigned() bool {
+	return c.Spec.Signature != nil
 }
 
 // String represents a human readable version of authentication settings.
@@ -236,10 +272,46 @@ type LicenseInfoSpecV3 struct {
 	// AWSAccountID limits usage to AWS instance within account ID
 	AWSAccountID string `json:"aws_account,omitempty"`
 	// SupportsKubernetes turns kubernetes support on or off
+	//
+	// Deprecated: use Features[FeatureKubernetes] instead. Kept for
+	// backward compatibility with v3 licenses; GetSupportsKubernetes and
+	// SetSupportsKubernetes keep both in sync.
 	SupportsKubernetes Bool `json:"k8s"`
+	// Features holds the entitlements granted by this license, keyed by
+	// feature name (FeatureKubernetes, FeatureAppAccess, FeatureDBAccess,
+	// FeatureMaxNodes, FeatureMaxUsers, ...). It supersedes the individual
+	// boolean/limit fields used by earlier license versions.
+	Features map[string]FeatureEntitlement `json:"features,omitempty"`
+	// UsageReportEndpoint is the control-plane endpoint usage reports are
+	// delivered to when ReportsUsage is set. When it is empty, UsageReporter
+	// still runs but every delivery fails and reports stay buffered.
+	UsageReportEndpoint string `json:"usage_report_endpoint,omitempty"`
+	// UsageReportInterval is how often usage reports are collected and
+	// sent, encoded as nanoseconds. Defaults to defaultUsageReportInterval
+	// when unset.
+	UsageReportInterval time.Duration `json:"usage_report_interval,omitempty"`
+	// NotBefore is the earliest time at which the license is valid. It is
+	// part of the signed payload and is checked by VerifyLicense. A
+	// *time.Time (rather than time.Time) is used so that omitempty
+	// actually suppresses the field when unset.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// Signature is the cryptographic signature over the license's metadata
+	// and spec, allowing operators to verify a license was issued by
+	// Gravitational without contacting the control plane. It is nil for
+	// unsigned (legacy) licenses.
+	Signature *LicenseSignature `json:"signature,omitempty"`
 }
 
-// LicenseInfoSpecV3Template is a template for V3 LicenseInfo JSON schema
+// V4 is a LicenseInfo resource version accepted by UnmarshalLicenseInfo
+// alongside V3. It is defined here, rather than relying on a
+// version elsewhere in the tree, because no v4 resource version exists
+// outside LicenseInfo.
+const V4 = "v4"
+
+// LicenseInfoSpecV3Template is a template for V3 LicenseInfo JSON schema.
+// It is also used to validate v4 LicenseInfo documents: both versions are
+// checked against this one template, so v3 and v4 documents accept the
+// same fields, the Features entitlement map included.
 const LicenseInfoSpecV3Template = `{
   "type": "object",
   "additionalProperties": false,
@@ -261,13 +333,29 @@ const LicenseInfoSpecV3Template = `{
 	},
 	"k8s": {
 		"type": ["string", "boolean"]
+	},
+	"not_before": {
+		"type": ["string"]
+	},
+	"signature": {
+		"type": ["object"]
+	},
+	"features": {
+		"type": ["object"]
+	},
+	"usage_report_endpoint": {
+		"type": ["string"]
+	},
+	"usage_report_interval": {
+		"type": ["number"]
 	}
   }
 }`
 
-// UnmarshalLicenseInfo unmarshals LicenseInfo from JSON or YAML
-// and validates schema
-func UnmarshalLicenseInfo(bytes []byte) (LicenseInfo, error) {
+// UnmarshalLicenseInfo unmarshals LicenseInfo from JSON or YAML, validates
+// its schema and applies opts. By default an unsigned license is accepted;
+// pass WithRequireSignature to refuse one.
+func UnmarshalLicenseInfo(bytes []byte, opts ...UnmarshalLicenseInfoOption) (LicenseInfo, error) {
 	var licenseInfo LicenseInfoV3
 
 	if len(bytes) == 0 {
@@ -281,14 +369,24 @@ func UnmarshalLicenseInfo(bytes []byte) (LicenseInfo, error) {
 		return nil, trace.BadParameter(err.Error())
 	}
 
-	if licenseInfo.Version != V3 {
-		return nil, trace.BadParameter("unsupported version %v, expected version %v", licenseInfo.Version, V3)
+	if licenseInfo.Version != V3 && licenseInfo.Version != V4 {
+		return nil, trace.BadParameter("unsupported version %v, expected version %v or %v", licenseInfo.Version, V3, V4)
 	}
 
 	if err := licenseInfo.CheckAndSetDefaults(); err != nil {
 		return nil, trace.Wrap(err)
 	}
 
+	var cfg unmarshalLicenseInfoConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.requireSignature {
+		if err := VerifyLicense(&licenseInfo, cfg.trustedKeys); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+
 	return &licenseInfo, nil
 }
 